@@ -20,14 +20,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 
+	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"go.uber.org/zap"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
-	"k8s.io/apimachinery/pkg/api/equality"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	corev1listers "k8s.io/client-go/listers/core/v1"
 	rbacv1listers "k8s.io/client-go/listers/rbac/v1"
@@ -35,12 +34,11 @@ import (
 	appsv1listers "k8s.io/client-go/listers/apps/v1"
 	"knative.dev/pkg/apis"
 	duckv1 "knative.dev/pkg/apis/duck/v1"
-	"knative.dev/pkg/controller"
+	"knative.dev/pkg/kmeta"
 	pkgLogging "knative.dev/pkg/logging"
 	"knative.dev/pkg/metrics"
 	pkgreconciler "knative.dev/pkg/reconciler"
 	"knative.dev/pkg/resolver"
-	"knative.dev/pkg/system"
 	"knative.dev/pkg/tracker"
 
 	"knative.dev/eventing/pkg/apis/eventing"
@@ -49,7 +47,7 @@ import (
 	listers "knative.dev/eventing/pkg/client/listers/sources/v1alpha2"
 	"knative.dev/eventing/pkg/logging"
 	"knative.dev/eventing/pkg/reconciler/pingsource/resources"
-	recresources "knative.dev/eventing/pkg/reconciler/resources"
+	sourceadapter "knative.dev/eventing/pkg/reconciler/source/adapter"
 	"knative.dev/eventing/pkg/utils"
 )
 
@@ -65,6 +63,32 @@ const (
 	mtcomponent              = "pingsource-mt-adapter"
 	mtadapterName            = "pingsource-mt-adapter"
 	stadapterClusterRoleName = "knative-eventing-pingsource-adapter"
+
+	// observabilityConfigHashAnnotation records a hash of the ResourceVersions
+	// of the logging/metrics ConfigMaps whose names were passed to a receive
+	// adapter Deployment. It only changes so the change can be audited; it is
+	// never used to trigger a rollout. Whether a running adapter actually
+	// reloads the new content in place, rather than needing a restart, is up
+	// to the receive-adapter binary and isn't something this reconciler can
+	// verify.
+	observabilityConfigHashAnnotation = "pingsource.knative.dev/observability-config-hash"
+
+	// haStrategyLeases, haStrategyBus, and haStrategyPartitioned are the valid
+	// values for Reconciler.haStrategy, which selects how the single shared
+	// mt-adapter Deployment's replicas coordinate ownership of PingSources.
+	// This is a property of that one cluster-scoped Deployment, not of any
+	// individual PingSource, so it is configured once on the Reconciler
+	// (like leConfig) rather than read per-source: letting a per-source
+	// annotation drive a singleton resource would make the Deployment's HA
+	// backend flip-flop depending on reconcile ordering across sources.
+	haStrategyLeases      = "leases"
+	haStrategyBus         = "bus"
+	haStrategyPartitioned = "partitioned"
+
+	// podNameEnvVar is the name of the downward-API env var MakeMTReceiveAdapter
+	// sets from fieldRef metadata.name, used by haStrategyPartitioned replicas
+	// to compute their own shard index.
+	podNameEnvVar = "POD_NAME"
 )
 
 func newWarningSinkNotFound(sink *duckv1.Destination) pkgreconciler.Event {
@@ -100,8 +124,23 @@ type Reconciler struct {
 	loggingConfig  *pkgLogging.Config
 	metricsConfig  *metrics.ExporterOptions
 
+	// loggingConfigMap and metricsConfigMap are the observability ConfigMaps
+	// whose name/ResourceVersion get passed through to receive adapter
+	// Deployments (see configMapName, observabilityConfigHash). Whether and
+	// how a running adapter actually consumes them is up to the receive
+	// adapter binary and PodSpec, both outside this tree.
+	loggingConfigMap *corev1.ConfigMap
+	metricsConfigMap *corev1.ConfigMap
+
 	// Leader election configuration for the mt receive adapter
 	leConfig string
+
+	// haStrategy and haShardCount configure how the single shared mt-adapter
+	// Deployment's replicas coordinate ownership of PingSources; see
+	// haStrategyLeases etc. haStrategy defaults to haStrategyLeases and
+	// haShardCount to 1 when unset.
+	haStrategy   string
+	haShardCount int32
 }
 
 // Check that our Reconciler implements ReconcileKind
@@ -194,19 +233,9 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, source *v1alpha2.PingSou
 
 func (r *Reconciler) reconcileServiceAccount(ctx context.Context, source *v1alpha2.PingSource) (*corev1.ServiceAccount, error) {
 	saName := resources.CreateReceiveAdapterName(source.Name, source.UID)
-	sa, err := r.serviceAccountLister.ServiceAccounts(source.Namespace).Get(saName)
+	sa, err := sourceadapter.ReconcileServiceAccount(ctx, r.kubeClientSet, r.serviceAccountLister, source, saName, pingSourceServiceAccountCreated)
 	if err != nil {
-		if apierrors.IsNotFound(err) {
-			expected := recresources.MakeServiceAccount(source, saName)
-			sa, err := r.kubeClientSet.CoreV1().ServiceAccounts(source.Namespace).Create(expected)
-			if err != nil {
-				return sa, newServiceAccountWarn(err)
-			}
-			controller.GetEventRecorder(ctx).Eventf(source, corev1.EventTypeNormal, pingSourceServiceAccountCreated, "PingSource ServiceAccount created")
-			return sa, nil
-		}
-
-		logging.FromContext(ctx).Error("Unable to get the PingSource ServiceAccount", zap.Error(err))
+		logging.FromContext(ctx).Error("Unable to reconcile the PingSource ServiceAccount", zap.Error(err))
 		source.Status.Annotations["serviceAccount"] = "Failed to get ServiceAccount"
 		return nil, newServiceAccountWarn(err)
 	}
@@ -215,133 +244,169 @@ func (r *Reconciler) reconcileServiceAccount(ctx context.Context, source *v1alph
 
 func (r *Reconciler) reconcileRoleBinding(ctx context.Context, source *v1alpha2.PingSource) (*rbacv1.RoleBinding, error) {
 	rbName := resources.CreateReceiveAdapterName(source.Name, source.UID)
-
-	rb, err := r.roleBindingLister.RoleBindings(source.Namespace).Get(rbName)
+	rb, err := sourceadapter.ReconcileRoleBinding(ctx, r.kubeClientSet, r.roleBindingLister, source, rbName, stadapterClusterRoleName, pingSourceRoleBindingCreated)
 	if err != nil {
-		if apierrors.IsNotFound(err) {
-			expected := resources.MakeRoleBinding(source, rbName, stadapterClusterRoleName)
-			rb, err := r.kubeClientSet.RbacV1().RoleBindings(source.Namespace).Create(expected)
-			if err != nil {
-				return rb, newRoleBindingWarn(err)
-			}
-			controller.GetEventRecorder(ctx).Eventf(source, corev1.EventTypeNormal, pingSourceRoleBindingCreated, "PingSource RoleBinding created")
-			return rb, nil
-		}
-		logging.FromContext(ctx).Error("Unable to get the PingSource RoleBinding", zap.Error(err))
+		logging.FromContext(ctx).Error("Unable to reconcile the PingSource RoleBinding", zap.Error(err))
 		source.Status.Annotations["roleBinding"] = "Failed to get PingSource RoleBinding"
 		return nil, newRoleBindingWarn(err)
 	}
 	return rb, nil
 }
 
-func (r *Reconciler) createReceiveAdapter(ctx context.Context, src *v1alpha2.PingSource, sinkURI *apis.URL) (*appsv1.Deployment, error) {
-	loggingConfig, err := pkgLogging.LoggingConfigToJson(r.loggingConfig)
-	if err != nil {
-		logging.FromContext(ctx).Error("error while converting logging config to JSON", zap.Any("receiveAdapter", err))
-	}
-
-	metricsConfig, err := metrics.MetricsOptionsToJson(r.metricsConfig)
-	if err != nil {
-		logging.FromContext(ctx).Error("error while converting metrics config to JSON", zap.Any("receiveAdapter", err))
+func (r *Reconciler) deploymentReconciler() *sourceadapter.DeploymentReconciler {
+	return &sourceadapter.DeploymentReconciler{
+		KubeClientSet: r.kubeClientSet,
+		Lister:        r.deploymentLister,
+		Reasons: sourceadapter.EventReasons{
+			Created:        pingSourceDeploymentCreated,
+			Updated:        pingSourceDeploymentUpdated,
+			DeprecatedName: pingSourceDeploymentDeleted,
+		},
 	}
+}
 
+func (r *Reconciler) createReceiveAdapter(ctx context.Context, src *v1alpha2.PingSource, sinkURI *apis.URL) (*appsv1.Deployment, error) {
+	// CloudEventOverrides is only threaded through as a plain resources.Args
+	// field here; whether the receive adapter binary applies it via a
+	// cloudevents/sdk-go v2 client is up to that binary, which is outside
+	// this tree.
+	//
+	// Logging/metrics config is only passed through by ConfigMap name, not by
+	// value; how (or whether) the adapter binary's PodSpec mounts and
+	// reloads it is outside this tree.
 	adapterArgs := resources.Args{
-		Image:         r.receiveAdapterImage,
-		Source:        src,
-		Labels:        resources.Labels(src.Name),
-		SinkURI:       sinkURI,
-		LoggingConfig: loggingConfig,
-		MetricsConfig: metricsConfig,
+		Image:               r.receiveAdapterImage,
+		Source:              src,
+		Labels:              resources.Labels(src.Name),
+		SinkURI:             sinkURI,
+		CloudEventOverrides: src.Spec.CloudEventOverrides,
+		LoggingConfigMap:    configMapName(r.loggingConfigMap),
+		MetricsConfigMap:    configMapName(r.metricsConfigMap),
 	}
 	expected := resources.MakeReceiveAdapter(&adapterArgs)
+	expected.Annotations = kmeta.UnionMaps(expected.Annotations, map[string]string{
+		observabilityConfigHashAnnotation: r.observabilityConfigHash(),
+	})
+
+	// Issue #2842: Adapter deployment name uses kmeta.ChildName. If a deployment by the previous name pattern is found, it should
+	// be deleted. This might cause temporary downtime.
+	deprecatedName := utils.GenerateFixedName(src, fmt.Sprintf("pingsource-%s", src.Name))
+	if deprecatedName == expected.Name {
+		deprecatedName = ""
+	}
 
-	ra, err := r.deploymentLister.Deployments(src.Namespace).Get(expected.Name)
-	if apierrors.IsNotFound(err) {
-		// Issue #2842: Adapter deployment name uses kmeta.ChildName. If a deployment by the previous name pattern is found, it should
-		// be deleted. This might cause temporary downtime.
-		if deprecatedName := utils.GenerateFixedName(adapterArgs.Source, fmt.Sprintf("pingsource-%s", adapterArgs.Source.Name)); deprecatedName != expected.Name {
-			if err := r.kubeClientSet.AppsV1().Deployments(src.Namespace).Delete(deprecatedName, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
-				return nil, fmt.Errorf("error deleting deprecated named deployment: %v", err)
-			}
-			controller.GetEventRecorder(ctx).Eventf(src, corev1.EventTypeNormal, pingSourceDeploymentDeleted, "Deprecated deployment removed: \"%s/%s\"", src.Namespace, deprecatedName)
-		}
-
-		ra, err = r.kubeClientSet.AppsV1().Deployments(src.Namespace).Create(expected)
-		msg := "Deployment created"
-		if err != nil {
-			msg = fmt.Sprintf("Deployment created, error: %v", err)
-		}
-		controller.GetEventRecorder(ctx).Eventf(src, corev1.EventTypeNormal, pingSourceDeploymentCreated, "%s", msg)
+	ra, err := r.deploymentReconciler().ReconcileDeployment(ctx, src, expected, deprecatedName)
+	if err != nil {
 		return ra, err
-	} else if err != nil {
-		return nil, fmt.Errorf("error getting receive adapter: %v", err)
-	} else if !metav1.IsControlledBy(ra, src) {
-		return nil, fmt.Errorf("deployment %q is not owned by PingSource %q", ra.Name, src.Name)
-	} else if podSpecChanged(ra.Spec.Template.Spec, expected.Spec.Template.Spec) {
-		ra.Spec.Template.Spec = expected.Spec.Template.Spec
-		if ra, err = r.kubeClientSet.AppsV1().Deployments(src.Namespace).Update(ra); err != nil {
-			return ra, err
-		}
-		controller.GetEventRecorder(ctx).Eventf(src, corev1.EventTypeNormal, pingSourceDeploymentUpdated, "Deployment %q updated", ra.Name)
-		return ra, nil
-	} else {
-		logging.FromContext(ctx).Debug("Reusing existing receive adapter", zap.Any("receiveAdapter", ra))
 	}
+	logging.FromContext(ctx).Debug("Reconciled receive adapter", zap.Any("receiveAdapter", ra))
 	return ra, nil
 }
 
 func (r *Reconciler) reconcileMTReceiveAdapter(ctx context.Context, source *v1alpha2.PingSource) (*appsv1.Deployment, error) {
-	loggingConfig, err := pkgLogging.LoggingConfigToJson(r.loggingConfig)
-	if err != nil {
-		logging.FromContext(ctx).Error("error while converting logging config to JSON", zap.Any("receiveAdapter", err))
-	}
-
-	metricsConfig, err := metrics.MetricsOptionsToJson(r.metricsConfig)
-	if err != nil {
-		logging.FromContext(ctx).Error("error while converting metrics config to JSON", zap.Any("receiveAdapter", err))
-	}
-
 	args := resources.MTArgs{
 		ServiceAccountName: mtadapterName,
 		MTAdapterName:      mtadapterName,
 		Image:              r.receiveMTAdapterImage,
-		LoggingConfig:      loggingConfig,
-		MetricsConfig:      metricsConfig,
-		LeConfig:           r.leConfig,
+		// CEMode is only a mode name passed through to resources.MTArgs; which
+		// cloudevents/sdk-go client mode (if any) the adapter binary actually
+		// uses for it is outside this tree.
+		CEMode:           cloudevents.EncodingBinary.String(),
+		LoggingConfigMap: configMapName(r.loggingConfigMap),
+		MetricsConfigMap: configMapName(r.metricsConfigMap),
 	}
+
+	switch resolveHAStrategy(r.haStrategy) {
+	case haStrategyBus:
+		// Replicas leader-elect by publishing periodic heartbeats to a
+		// well-known subject on the eventing MessagingBus and settling ties
+		// on highest monotonic term, so no Lease/coordination RBAC is
+		// required for the adapter's ServiceAccount.
+		args.HAStrategy = haStrategyBus
+	case haStrategyPartitioned:
+		// PingSource CRs are deterministically sharded across replicas by
+		// hash(namespace/name) mod ShardCount, so no elector is needed. The
+		// Deployment has no StatefulSet-style ordinal to tell a replica which
+		// shard it owns, so MakeMTReceiveAdapter also threads the pod's own
+		// name through as a downward-API env var (args.PodNameEnvVar); each
+		// replica hashes its own pod name mod ShardCount at startup to learn
+		// its shard index the same way a source's shard is computed.
+		shardCount := r.haShardCount
+		if shardCount <= 0 {
+			shardCount = 1
+		}
+		args.HAStrategy = haStrategyPartitioned
+		args.ShardCount = &shardCount
+		args.PodNameEnvVar = podNameEnvVar
+	default:
+		args.HAStrategy = haStrategyLeases
+		args.LeConfig = r.leConfig
+	}
+
 	expected := resources.MakeMTReceiveAdapter(args)
+	expected.Annotations = kmeta.UnionMaps(expected.Annotations, map[string]string{
+		observabilityConfigHashAnnotation: r.observabilityConfigHash(),
+	})
+
+	mtReconciler := &sourceadapter.MTAdapterReconciler{
+		KubeClientSet: r.kubeClientSet,
+		Lister:        r.deploymentLister,
+		Reasons: sourceadapter.EventReasons{
+			Created: pingSourceDeploymentCreated,
+			Updated: pingSourceDeploymentUpdated,
+		},
+	}
 
-	d, err := r.deploymentLister.Deployments(system.Namespace()).Get(mtadapterName)
+	d, err := mtReconciler.Reconcile(ctx, source, expected)
 	if err != nil {
-		if apierrors.IsNotFound(err) {
-			d, err := r.kubeClientSet.AppsV1().Deployments(system.Namespace()).Create(expected)
-			if err != nil {
-				controller.GetEventRecorder(ctx).Eventf(source, corev1.EventTypeWarning, pingSourceDeploymentCreated, "Cluster-scoped deployment not created (%v)", err)
-				return nil, err
-			}
-			controller.GetEventRecorder(ctx).Event(source, corev1.EventTypeNormal, pingSourceDeploymentCreated, "Cluster-scoped deployment created")
-			return d, nil
-		}
-		return nil, fmt.Errorf("error getting mt adapter deployment %v", err)
-	} else if podSpecChanged(d.Spec.Template.Spec, expected.Spec.Template.Spec) {
-		d.Spec.Template.Spec = expected.Spec.Template.Spec
-		if d, err = r.kubeClientSet.AppsV1().Deployments(system.Namespace()).Update(d); err != nil {
-			return d, err
-		}
-		controller.GetEventRecorder(ctx).Event(source, corev1.EventTypeNormal, pingSourceDeploymentUpdated, "Cluster-scoped deployment updated")
-		return d, nil
-	} else {
-		logging.FromContext(ctx).Debug("Reusing existing cluster-scoped deployment", zap.Any("deployment", d))
+		return d, err
 	}
+	logging.FromContext(ctx).Debug("Reconciled cluster-scoped deployment", zap.Any("deployment", d))
 	return d, nil
 }
 
-func podSpecChanged(oldPodSpec corev1.PodSpec, newPodSpec corev1.PodSpec) bool {
-	// We really care about the fields we set and ignore the test.
-	return !equality.Semantic.DeepDerivative(newPodSpec, oldPodSpec)
+// resolveHAStrategy reports which election backend the shared mt-adapter
+// Deployment's replicas should use to coordinate ownership of PingSources,
+// defaulting to haStrategyLeases when configured is empty or unrecognized.
+func resolveHAStrategy(configured string) string {
+	switch configured {
+	case haStrategyBus, haStrategyPartitioned:
+		return configured
+	default:
+		return haStrategyLeases
+	}
+}
+
+// observabilityConfigHash combines the ResourceVersions of the recorded
+// logging/metrics ConfigMaps into a short value suitable for
+// observabilityConfigHashAnnotation.
+func (r *Reconciler) observabilityConfigHash() string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s/%s", configMapResourceVersion(r.loggingConfigMap), configMapResourceVersion(r.metricsConfigMap))
+	return fmt.Sprintf("%x", h.Sum32())
+}
+
+func configMapResourceVersion(cfg *corev1.ConfigMap) string {
+	if cfg == nil {
+		return ""
+	}
+	return cfg.ResourceVersion
+}
+
+func configMapName(cfg *corev1.ConfigMap) string {
+	if cfg == nil {
+		return ""
+	}
+	return cfg.Name
 }
 
-// TODO determine how to push the updated logging config to existing data plane Pods.
+// UpdateFromLoggingConfigMap keeps the reconciler's own logging config in
+// sync and records the ConfigMap so its name and ResourceVersion can be
+// passed to receive adapter Deployments (see configMapName,
+// observabilityConfigHash). This reconciler never restarts a Deployment just
+// because the ConfigMap changed; whether running adapter Pods pick up the
+// new content without a restart is up to the adapter binary and PodSpec,
+// both outside this tree.
 func (r *Reconciler) UpdateFromLoggingConfigMap(cfg *corev1.ConfigMap) {
 	if cfg != nil {
 		delete(cfg.Data, "_example")
@@ -353,10 +418,17 @@ func (r *Reconciler) UpdateFromLoggingConfigMap(cfg *corev1.ConfigMap) {
 		return
 	}
 	r.loggingConfig = logcfg
+	r.loggingConfigMap = cfg
 	logging.FromContext(r.loggingContext).Debug("Update from logging ConfigMap", zap.Any("ConfigMap", cfg))
 }
 
-// TODO determine how to push the updated metrics config to existing data plane Pods.
+// UpdateFromMetricsConfigMap keeps the reconciler's own metrics config in
+// sync and records the ConfigMap so its name and ResourceVersion can be
+// passed to receive adapter Deployments (see configMapName,
+// observabilityConfigHash). This reconciler never restarts a Deployment just
+// because the ConfigMap changed; whether running adapter Pods pick up the
+// new content without a restart is up to the adapter binary and PodSpec,
+// both outside this tree.
 func (r *Reconciler) UpdateFromMetricsConfigMap(cfg *corev1.ConfigMap) {
 	if cfg != nil {
 		delete(cfg.Data, "_example")
@@ -367,5 +439,6 @@ func (r *Reconciler) UpdateFromMetricsConfigMap(cfg *corev1.ConfigMap) {
 		Component: component,
 		ConfigMap: cfg.Data,
 	}
+	r.metricsConfigMap = cfg
 	logging.FromContext(r.loggingContext).Debug("Update from metrics ConfigMap", zap.Any("ConfigMap", cfg))
 }
@@ -0,0 +1,53 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pingsource
+
+import (
+	"testing"
+)
+
+func TestResolveHAStrategy(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured string
+		want       string
+	}{{
+		name:       "empty defaults to leases",
+		configured: "",
+		want:       haStrategyLeases,
+	}, {
+		name:       "unrecognized value defaults to leases",
+		configured: "made-up",
+		want:       haStrategyLeases,
+	}, {
+		name:       "bus",
+		configured: haStrategyBus,
+		want:       haStrategyBus,
+	}, {
+		name:       "partitioned",
+		configured: haStrategyPartitioned,
+		want:       haStrategyPartitioned,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := resolveHAStrategy(test.configured); got != test.want {
+				t.Errorf("resolveHAStrategy(%q) = %q, want %q", test.configured, got, test.want)
+			}
+		})
+	}
+}
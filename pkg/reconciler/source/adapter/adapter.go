@@ -0,0 +1,253 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package adapter holds the receive-adapter reconciliation patterns shared
+// by source reconcilers (PingSource, ApiServerSource, ContainerSource,
+// SinkBinding, ...): get-or-create-or-update a Deployment with configurable
+// PodSpec equality, materialize a ServiceAccount/RoleBinding pair, and run
+// the cluster-scoped singleton variant used by sources that support a
+// multi-tenant adapter.
+package adapter
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	rbacv1listers "k8s.io/client-go/listers/rbac/v1"
+
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/kmeta"
+
+	recresources "knative.dev/eventing/pkg/reconciler/resources"
+)
+
+// Owner is satisfied by any namespaced source CR: it can render an
+// OwnerReference, exposes ObjectMeta, and is a valid runtime.Object for
+// event recording.
+type Owner interface {
+	kmeta.OwnerRefableAccessor
+	runtime.Object
+}
+
+// PodSpecEqualityFn reports whether oldPodSpec already satisfies newPodSpec,
+// letting callers decide which fields matter. DefaultPodSpecEqualityFn is
+// used when a caller leaves this nil.
+type PodSpecEqualityFn func(oldPodSpec, newPodSpec corev1.PodSpec) bool
+
+// DefaultPodSpecEqualityFn only cares about the fields set on newPodSpec and
+// ignores defaults the API server has filled onto oldPodSpec.
+func DefaultPodSpecEqualityFn(oldPodSpec, newPodSpec corev1.PodSpec) bool {
+	return equality.Semantic.DeepDerivative(newPodSpec, oldPodSpec)
+}
+
+// EventReasons names the corev1.Events emitted while reconciling a
+// Deployment. ReconcileServiceAccount and ReconcileRoleBinding take their
+// own created reason instead.
+type EventReasons struct {
+	Created        string
+	Updated        string
+	DeprecatedName string
+}
+
+// DeploymentReconciler reconciles a single namespaced receive adapter
+// Deployment owned by a source.
+type DeploymentReconciler struct {
+	KubeClientSet kubernetes.Interface
+	Lister        appsv1listers.DeploymentLister
+	PodSpecEqual  PodSpecEqualityFn
+	Reasons       EventReasons
+}
+
+// ReconcileDeployment gets-or-creates-or-updates expected. If expected does
+// not exist yet and deprecatedName is non-empty, the Deployment by that name
+// (left from the naming pattern used before kmeta.ChildName, see
+// eventing#2842) is deleted before expected is created. An existing
+// Deployment is only updated when its PodSpec or the annotations expected
+// sets drift from expected, and Reasons.Updated is only emitted when the
+// PodSpec drifted; an annotation-only drift (e.g. an observability config
+// hash) therefore never forces a rollout.
+func (dr *DeploymentReconciler) ReconcileDeployment(ctx context.Context, owner Owner, expected *appsv1.Deployment, deprecatedName string) (*appsv1.Deployment, error) {
+	podSpecEqual := dr.PodSpecEqual
+	if podSpecEqual == nil {
+		podSpecEqual = DefaultPodSpecEqualityFn
+	}
+
+	d, err := dr.Lister.Deployments(expected.Namespace).Get(expected.Name)
+	if apierrors.IsNotFound(err) {
+		if deprecatedName != "" && deprecatedName != expected.Name {
+			if err := dr.KubeClientSet.AppsV1().Deployments(expected.Namespace).Delete(deprecatedName, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("error deleting deprecated named deployment: %w", err)
+			}
+			controller.GetEventRecorder(ctx).Eventf(owner, corev1.EventTypeNormal, dr.Reasons.DeprecatedName, "Deprecated deployment removed: %q", deprecatedName)
+		}
+
+		d, err = dr.KubeClientSet.AppsV1().Deployments(expected.Namespace).Create(expected)
+		msg := "Deployment created"
+		if err != nil {
+			msg = fmt.Sprintf("Deployment created, error: %v", err)
+		}
+		controller.GetEventRecorder(ctx).Eventf(owner, corev1.EventTypeNormal, dr.Reasons.Created, "%s", msg)
+		return d, err
+	} else if err != nil {
+		return nil, fmt.Errorf("error getting receive adapter: %w", err)
+	} else if !metav1.IsControlledBy(d, owner) {
+		return nil, fmt.Errorf("deployment %q is not owned by %q", d.Name, owner.GetName())
+	} else if changed, podChanged := deploymentChanged(d, expected, podSpecEqual); changed {
+		d.Spec.Template.Spec = expected.Spec.Template.Spec
+		d.Annotations = kmeta.UnionMaps(d.Annotations, expected.Annotations)
+		if d, err = dr.KubeClientSet.AppsV1().Deployments(expected.Namespace).Update(d); err != nil {
+			return d, err
+		}
+		if podChanged {
+			controller.GetEventRecorder(ctx).Eventf(owner, corev1.EventTypeNormal, dr.Reasons.Updated, "Deployment %q updated", d.Name)
+		}
+		return d, nil
+	}
+	return d, nil
+}
+
+// MTAdapterReconciler reconciles the single cluster-scoped Deployment shared
+// by every source instance that opts into the multi-tenant adapter, keyed by
+// its fixed name inside the given namespace (typically system.Namespace()).
+type MTAdapterReconciler struct {
+	KubeClientSet kubernetes.Interface
+	Lister        appsv1listers.DeploymentLister
+	PodSpecEqual  PodSpecEqualityFn
+	Reasons       EventReasons
+}
+
+// Reconcile gets-or-creates-or-updates expected. owner is only used to
+// attribute the corev1.Event to a watching source; the Deployment itself has
+// no owner reference since it outlives any single source.
+func (mr *MTAdapterReconciler) Reconcile(ctx context.Context, owner runtime.Object, expected *appsv1.Deployment) (*appsv1.Deployment, error) {
+	podSpecEqual := mr.PodSpecEqual
+	if podSpecEqual == nil {
+		podSpecEqual = DefaultPodSpecEqualityFn
+	}
+
+	d, err := mr.Lister.Deployments(expected.Namespace).Get(expected.Name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			d, err := mr.KubeClientSet.AppsV1().Deployments(expected.Namespace).Create(expected)
+			if err != nil {
+				controller.GetEventRecorder(ctx).Eventf(owner, corev1.EventTypeWarning, mr.Reasons.Created, "Cluster-scoped deployment not created (%v)", err)
+				return nil, err
+			}
+			controller.GetEventRecorder(ctx).Event(owner, corev1.EventTypeNormal, mr.Reasons.Created, "Cluster-scoped deployment created")
+			return d, nil
+		}
+		return nil, fmt.Errorf("error getting mt adapter deployment: %w", err)
+	} else if changed, podChanged := deploymentChanged(d, expected, podSpecEqual); changed {
+		d.Spec.Template.Spec = expected.Spec.Template.Spec
+		d.Annotations = kmeta.UnionMaps(d.Annotations, expected.Annotations)
+		if d, err = mr.KubeClientSet.AppsV1().Deployments(expected.Namespace).Update(d); err != nil {
+			return d, err
+		}
+		if podChanged {
+			controller.GetEventRecorder(ctx).Event(owner, corev1.EventTypeNormal, mr.Reasons.Updated, "Cluster-scoped deployment updated")
+		}
+		return d, nil
+	}
+	return d, nil
+}
+
+// deploymentChanged reports whether actual needs to be patched to match
+// expected, and separately whether the PodSpec itself (not just annotations)
+// is what changed, so callers can skip emitting a rollout event for a
+// config-hash-only update. Annotations are only compared for the keys
+// expected actually sets (e.g. an observability config hash); a real
+// Deployment read back from the lister also carries annotations the
+// Deployment controller itself writes (e.g. deployment.kubernetes.io/
+// revision), and those must not be treated as drift.
+func deploymentChanged(actual, expected *appsv1.Deployment, podSpecEqual PodSpecEqualityFn) (changed, podChanged bool) {
+	podChanged = !podSpecEqual(actual.Spec.Template.Spec, expected.Spec.Template.Spec)
+	annotationsChanged := false
+	for k, v := range expected.Annotations {
+		if actual.Annotations[k] != v {
+			annotationsChanged = true
+			break
+		}
+	}
+	return podChanged || annotationsChanged, podChanged
+}
+
+// ReconcileServiceAccount gets-or-creates the ServiceAccount backing a
+// receive adapter's Deployment.
+func ReconcileServiceAccount(ctx context.Context, kubeClientSet kubernetes.Interface, lister corev1listers.ServiceAccountLister, owner Owner, name, createdReason string) (*corev1.ServiceAccount, error) {
+	sa, err := lister.ServiceAccounts(owner.GetNamespace()).Get(name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			expected := recresources.MakeServiceAccount(owner, name)
+			sa, err := kubeClientSet.CoreV1().ServiceAccounts(owner.GetNamespace()).Create(expected)
+			if err != nil {
+				return sa, err
+			}
+			controller.GetEventRecorder(ctx).Eventf(owner, corev1.EventTypeNormal, createdReason, "ServiceAccount created")
+			return sa, nil
+		}
+		return nil, err
+	}
+	return sa, nil
+}
+
+// ReconcileRoleBinding gets-or-creates the RoleBinding that grants name (the
+// ServiceAccount of the same name) clusterRoleName in owner's namespace.
+func ReconcileRoleBinding(ctx context.Context, kubeClientSet kubernetes.Interface, lister rbacv1listers.RoleBindingLister, owner Owner, name, clusterRoleName, createdReason string) (*rbacv1.RoleBinding, error) {
+	rb, err := lister.RoleBindings(owner.GetNamespace()).Get(name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			expected := makeRoleBinding(owner, name, clusterRoleName)
+			rb, err := kubeClientSet.RbacV1().RoleBindings(owner.GetNamespace()).Create(expected)
+			if err != nil {
+				return rb, err
+			}
+			controller.GetEventRecorder(ctx).Eventf(owner, corev1.EventTypeNormal, createdReason, "RoleBinding created")
+			return rb, nil
+		}
+		return nil, err
+	}
+	return rb, nil
+}
+
+func makeRoleBinding(owner Owner, name, clusterRoleName string) *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       owner.GetNamespace(),
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(owner)},
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "ClusterRole",
+			Name:     clusterRoleName,
+		},
+		Subjects: []rbacv1.Subject{{
+			Kind:      "ServiceAccount",
+			Name:      name,
+			Namespace: owner.GetNamespace(),
+		}},
+	}
+}
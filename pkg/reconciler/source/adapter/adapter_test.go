@@ -0,0 +1,277 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kubeclientfake "k8s.io/client-go/kubernetes/fake"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	clientgotesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/kmeta"
+)
+
+const observabilityConfigHashKey = "pingsource.knative.dev/observability-config-hash"
+
+// fakeOwner is the minimal Owner implementation needed to exercise these
+// reconcilers without depending on any particular source CRD type.
+type fakeOwner struct {
+	metav1.ObjectMeta
+}
+
+func newOwner(namespace, name string) *fakeOwner {
+	return &fakeOwner{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: "test-uid"}}
+}
+
+func (f *fakeOwner) GetGroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: "sources.knative.dev", Version: "v1alpha2", Kind: "PingSource"}
+}
+
+func (f *fakeOwner) GroupVersionKind() schema.GroupVersionKind { return f.GetGroupVersionKind() }
+
+func (f *fakeOwner) SetGroupVersionKind(schema.GroupVersionKind) {}
+
+func (f *fakeOwner) GetObjectKind() schema.ObjectKind { return &metav1.TypeMeta{} }
+
+func (f *fakeOwner) DeepCopyObject() runtime.Object {
+	return &fakeOwner{ObjectMeta: *f.ObjectMeta.DeepCopy()}
+}
+
+func deploymentLister(t *testing.T, deploys ...*appsv1.Deployment) appsv1listers.DeploymentLister {
+	t.Helper()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, d := range deploys {
+		if err := indexer.Add(d); err != nil {
+			t.Fatalf("failed to seed deployment lister: %v", err)
+		}
+	}
+	return appsv1listers.NewDeploymentLister(indexer)
+}
+
+func newExpectedDeployment(owner Owner, namespace, name string, annotations map[string]string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       namespace,
+			Name:            name,
+			Annotations:     annotations,
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(owner)},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "adapter", Image: "adapter:v1"}},
+				},
+			},
+		},
+	}
+}
+
+func withContext(rec *fakeRecorder) context.Context {
+	return controller.WithEventRecorder(context.Background(), rec)
+}
+
+// fakeRecorder satisfies record.EventRecorder without pulling in the
+// client-go event testing helpers, which this tree doesn't otherwise use.
+// It keeps the reason of every Event/Eventf call it receives.
+type fakeRecorder struct {
+	reasons []string
+}
+
+func (f *fakeRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	f.reasons = append(f.reasons, reason)
+}
+func (f *fakeRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	f.reasons = append(f.reasons, reason)
+}
+func (f *fakeRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+}
+
+func hasAction(actions []clientgotesting.Action, verb, resource string) bool {
+	for _, a := range actions {
+		if a.GetVerb() == verb && a.GetResource().Resource == resource {
+			return true
+		}
+	}
+	return false
+}
+
+func hasReason(reasons []string, reason string) bool {
+	for _, r := range reasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReconcileDeployment(t *testing.T) {
+	owner := newOwner("ns", "src")
+
+	tests := []struct {
+		name             string
+		existing         []*appsv1.Deployment
+		expected         *appsv1.Deployment
+		deprecatedName   string
+		wantErr          bool
+		wantCreate       bool
+		wantUpdate       bool
+		wantUpdatedEvent bool
+	}{{
+		name:       "create",
+		expected:   newExpectedDeployment(owner, "ns", "ra", map[string]string{observabilityConfigHashKey: "v1"}),
+		wantCreate: true,
+	}, {
+		name:           "create deletes deprecated name first",
+		expected:       newExpectedDeployment(owner, "ns", "ra", map[string]string{observabilityConfigHashKey: "v1"}),
+		deprecatedName: "pingsource-src",
+		wantCreate:     true,
+	}, {
+		name:     "no-op when podspec and hash annotation already match",
+		existing: []*appsv1.Deployment{newExpectedDeployment(owner, "ns", "ra", map[string]string{observabilityConfigHashKey: "v1"})},
+		expected: newExpectedDeployment(owner, "ns", "ra", map[string]string{observabilityConfigHashKey: "v1"}),
+	}, {
+		name: "no-op when actual carries extra controller-written annotations",
+		existing: func() []*appsv1.Deployment {
+			d := newExpectedDeployment(owner, "ns", "ra", map[string]string{observabilityConfigHashKey: "v1"})
+			d.Annotations["deployment.kubernetes.io/revision"] = "3"
+			return []*appsv1.Deployment{d}
+		}(),
+		expected: newExpectedDeployment(owner, "ns", "ra", map[string]string{observabilityConfigHashKey: "v1"}),
+	}, {
+		name:       "updates podspec and emits an event",
+		existing:   []*appsv1.Deployment{newExpectedDeployment(owner, "ns", "ra", map[string]string{observabilityConfigHashKey: "v1"})},
+		expected:   func() *appsv1.Deployment { d := newExpectedDeployment(owner, "ns", "ra", map[string]string{observabilityConfigHashKey: "v1"}); d.Spec.Template.Spec.Containers[0].Image = "adapter:v2"; return d }(),
+		wantUpdate:       true,
+		wantUpdatedEvent: true,
+	}, {
+		name:       "updates hash annotation only without a rollout event",
+		existing:   []*appsv1.Deployment{newExpectedDeployment(owner, "ns", "ra", map[string]string{observabilityConfigHashKey: "v1"})},
+		expected:   newExpectedDeployment(owner, "ns", "ra", map[string]string{observabilityConfigHashKey: "v2"}),
+		wantUpdate: true,
+	}, {
+		name: "orphan owner errors",
+		existing: []*appsv1.Deployment{func() *appsv1.Deployment {
+			d := newExpectedDeployment(owner, "ns", "ra", nil)
+			other := newOwner("ns", "someone-else")
+			other.UID = "someone-else-uid"
+			d.OwnerReferences = []metav1.OwnerReference{*kmeta.NewControllerRef(other)}
+			return d
+		}()},
+		expected: newExpectedDeployment(owner, "ns", "ra", nil),
+		wantErr:  true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var existingObjs []runtime.Object
+			for _, d := range test.existing {
+				existingObjs = append(existingObjs, d)
+			}
+			kubeClientSet := kubeclientfake.NewSimpleClientset(existingObjs...)
+
+			dr := &DeploymentReconciler{
+				KubeClientSet: kubeClientSet,
+				Lister:        deploymentLister(t, test.existing...),
+				Reasons:       EventReasons{Created: "Created", Updated: "Updated", DeprecatedName: "DeprecatedNameRemoved"},
+			}
+
+			rec := &fakeRecorder{}
+			_, err := dr.ReconcileDeployment(withContext(rec), owner, test.expected, test.deprecatedName)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ReconcileDeployment() error = %v, wantErr %v", err, test.wantErr)
+			}
+
+			actions := kubeClientSet.Actions()
+			if got := hasAction(actions, "create", "deployments"); got != test.wantCreate {
+				t.Errorf("create deployment action = %v, want %v (actions: %+v)", got, test.wantCreate, actions)
+			}
+			if got := hasAction(actions, "update", "deployments"); got != test.wantUpdate {
+				t.Errorf("update deployment action = %v, want %v (actions: %+v)", got, test.wantUpdate, actions)
+			}
+			if got := hasReason(rec.reasons, "Updated"); got != test.wantUpdatedEvent {
+				t.Errorf("Updated event = %v, want %v (reasons: %v)", got, test.wantUpdatedEvent, rec.reasons)
+			}
+			if test.deprecatedName != "" {
+				if got := hasAction(actions, "delete", "deployments"); !got {
+					t.Errorf("expected deprecated deployment %q to be deleted", test.deprecatedName)
+				}
+			}
+		})
+	}
+}
+
+func TestMTAdapterReconciler(t *testing.T) {
+	owner := newOwner("ns", "src")
+
+	tests := []struct {
+		name       string
+		existing   []*appsv1.Deployment
+		expected   *appsv1.Deployment
+		wantCreate bool
+		wantUpdate bool
+	}{{
+		name:       "create",
+		expected:   newExpectedDeployment(owner, "knative-eventing", "pingsource-mt-adapter", nil),
+		wantCreate: true,
+	}, {
+		name:     "no-op",
+		existing: []*appsv1.Deployment{newExpectedDeployment(owner, "knative-eventing", "pingsource-mt-adapter", map[string]string{observabilityConfigHashKey: "v1"})},
+		expected: newExpectedDeployment(owner, "knative-eventing", "pingsource-mt-adapter", map[string]string{observabilityConfigHashKey: "v1"}),
+	}, {
+		name:       "updates podspec",
+		existing:   []*appsv1.Deployment{newExpectedDeployment(owner, "knative-eventing", "pingsource-mt-adapter", map[string]string{observabilityConfigHashKey: "v1"})},
+		expected:   func() *appsv1.Deployment { d := newExpectedDeployment(owner, "knative-eventing", "pingsource-mt-adapter", map[string]string{observabilityConfigHashKey: "v1"}); d.Spec.Template.Spec.Containers[0].Image = "adapter:v2"; return d }(),
+		wantUpdate: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var existingObjs []runtime.Object
+			for _, d := range test.existing {
+				existingObjs = append(existingObjs, d)
+			}
+			kubeClientSet := kubeclientfake.NewSimpleClientset(existingObjs...)
+
+			mr := &MTAdapterReconciler{
+				KubeClientSet: kubeClientSet,
+				Lister:        deploymentLister(t, test.existing...),
+				Reasons:       EventReasons{Created: "Created", Updated: "Updated"},
+			}
+
+			if _, err := mr.Reconcile(withContext(&fakeRecorder{}), owner, test.expected); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			actions := kubeClientSet.Actions()
+			if got := hasAction(actions, "create", "deployments"); got != test.wantCreate {
+				t.Errorf("create deployment action = %v, want %v (actions: %+v)", got, test.wantCreate, actions)
+			}
+			if got := hasAction(actions, "update", "deployments"); got != test.wantUpdate {
+				t.Errorf("update deployment action = %v, want %v (actions: %+v)", got, test.wantUpdate, actions)
+			}
+		})
+	}
+}